@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// MountBlob attempts to mount a blob that already exists in sourceRepo into
+// destRepo without re-uploading it, via
+// POST /v2/<destRepo>/blobs/uploads/?mount=<digest>&from=<sourceRepo>.
+//
+// This is the operation a manifest-list push needs: the individual
+// per-architecture manifests were fetched from (and their layers live in)
+// their own repositories, and mounting lets those layers be referenced from
+// destRepo instead of downloading and re-uploading every one.
+//
+// If the registry does not support mounting across repositories (or the
+// source blob isn't visible to the caller) it responds 202 Accepted with a
+// fresh upload session instead of 201 Created. MountBlob reports that case
+// by returning mounted=false along with the Location of the started upload
+// session, so the caller can fall back to uploading the blob normally.
+func (registry *Registry) MountBlob(destRepo, sourceRepo string, dgst digest.Digest) (mounted bool, location string, err error) {
+	return registry.MountBlobWithContext(context.Background(), destRepo, sourceRepo, dgst)
+}
+
+func (registry *Registry) MountBlobWithContext(ctx context.Context, destRepo, sourceRepo string, dgst digest.Digest) (mounted bool, location string, err error) {
+	url := registry.url("/v2/%s/blobs/uploads/?mount=%s&from=%s", destRepo, dgst, sourceRepo)
+	registry.Logf("registry.blob.mount url=%s destRepo=%s sourceRepo=%s digest=%s", url, destRepo, sourceRepo, dgst)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return false, "", err
+	}
+
+	resp, err := registry.Client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	return mountResult(resp.StatusCode, resp.Status, resp.Header.Get("Location"), destRepo, sourceRepo, dgst)
+}
+
+// mountResult interprets the response to a blob mount request: 201 means
+// the blob is now mounted, 202 means the registry started a normal upload
+// session instead (location is where to PUT/PATCH it), and anything else is
+// an error. Split out from MountBlobWithContext so it can be unit tested
+// without a live registry.
+func mountResult(statusCode int, status, location, destRepo, sourceRepo string, dgst digest.Digest) (mounted bool, loc string, err error) {
+	switch statusCode {
+	case http.StatusCreated:
+		return true, location, nil
+	case http.StatusAccepted:
+		return false, location, nil
+	default:
+		return false, "", fmt.Errorf("registry: unexpected status mounting blob %s from %s into %s: %s", dgst, sourceRepo, destRepo, status)
+	}
+}
@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMountResultCreated(t *testing.T) {
+	mounted, location, err := mountResult(http.StatusCreated, "201 Created", "/v2/dest/blobs/sha256:abc", "dest", "source", testDigest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mounted {
+		t.Fatal("expected mounted=true for 201 Created")
+	}
+	if location != "/v2/dest/blobs/sha256:abc" {
+		t.Fatalf("location = %q", location)
+	}
+}
+
+func TestMountResultAcceptedFallsBackToUpload(t *testing.T) {
+	mounted, location, err := mountResult(http.StatusAccepted, "202 Accepted", "/v2/dest/blobs/uploads/abc-session", "dest", "source", testDigest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mounted {
+		t.Fatal("expected mounted=false for 202 Accepted")
+	}
+	if location != "/v2/dest/blobs/uploads/abc-session" {
+		t.Fatalf("location = %q", location)
+	}
+}
+
+func TestMountResultUnexpectedStatus(t *testing.T) {
+	mounted, _, err := mountResult(http.StatusNotFound, "404 Not Found", "", "dest", "source", testDigest)
+	if err == nil {
+		t.Fatal("expected an error for an unexpected status code")
+	}
+	if mounted {
+		t.Fatal("expected mounted=false on error")
+	}
+}
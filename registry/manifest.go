@@ -2,17 +2,77 @@ package registry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
 	digest "github.com/opencontainers/go-digest"
 )
 
+// ErrUnexpectedSchemaVersion is returned by Manifest and ManifestV2 when the
+// registry's response doesn't match the schema version the caller asked
+// for, e.g. calling ManifestV2 against a tag that resolves to a schema1
+// manifest because the registry doesn't have a schema2 conversion for it.
+var ErrUnexpectedSchemaVersion = errors.New("registry: unexpected schema version in manifest response")
+
+// manifestEnvelope is the subset of every manifest's fields needed to check
+// its schema version and media type without fully unmarshaling it.
+type manifestEnvelope struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+}
+
+// checkSchemaVersion verifies that a manifest response actually matches the
+// schema version the caller asked for. The decision is keyed off the body's
+// own schemaVersion/mediaType fields, since that's what distinguishes e.g.
+// schema1 from schema2; Content-Type is only used as corroboration when
+// present, and compared after stripping any "; charset=..." parameter,
+// against every media type that's valid for wantSchemaVersion (schema1
+// responses use the signed schema1.MediaTypeSignedManifest, not
+// schema1.MediaTypeManifest, as their Content-Type). It returns
+// ErrUnexpectedSchemaVersion when they don't agree.
+func checkSchemaVersion(contentType string, body []byte, wantSchemaVersion int, wantMediaTypes ...string) error {
+	if contentType != "" {
+		if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = parsed
+		}
+		if !containsMediaType(wantMediaTypes, contentType) {
+			return ErrUnexpectedSchemaVersion
+		}
+	}
+
+	var envelope manifestEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return err
+	}
+	if envelope.SchemaVersion != wantSchemaVersion {
+		return ErrUnexpectedSchemaVersion
+	}
+	if envelope.MediaType != "" && !containsMediaType(wantMediaTypes, envelope.MediaType) {
+		return ErrUnexpectedSchemaVersion
+	}
+	return nil
+}
+
+func containsMediaType(mediaTypes []string, mediaType string) bool {
+	for _, m := range mediaTypes {
+		if m == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
 type ManifestList struct {
 	MediaType     string          `json:"mediaType"`
 	SchemaVersion int             `json:"schemaVersion"`
@@ -27,17 +87,38 @@ type ManifestEntry struct {
 }
 
 type PlatformSpec struct {
-	Architecture string `json:"architecture"`
-	OS           string `json:"os"`
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	Variant      string   `json:"variant,omitempty"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Features     []string `json:"features,omitempty"`
 }
 
 const manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
 
+// acceptAllManifestTypes is the Accept header sent by GetManifest so the
+// registry can respond with whichever of schema1, schema2, OCI manifest,
+// Docker manifest list, or OCI image index it actually has stored for the
+// reference.
+const acceptAllManifestTypes = schema1.MediaTypeManifest + ", " +
+	schema2.MediaTypeManifest + ", " +
+	ocischema.MediaTypeManifest + ", " +
+	manifestlist.MediaTypeManifestList + ", " +
+	manifestlist.MediaTypeImageIndex
+
+// Manifest fetches a schema1 manifest. It is a thin wrapper around
+// ManifestWithContext using context.Background(); see that method to pass a
+// context for cancellation, deadlines, or tracing.
 func (registry *Registry) Manifest(repository, reference string) (*schema1.SignedManifest, error) {
+	return registry.ManifestWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestWithContext(ctx context.Context, repository, reference string) (*schema1.SignedManifest, error) {
 	url := registry.url("/v2/%s/manifests/%s", repository, reference)
 	registry.Logf("registry.manifest.get url=%s repository=%s reference=%s", url, repository, reference)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +135,10 @@ func (registry *Registry) Manifest(repository, reference string) (*schema1.Signe
 		return nil, err
 	}
 
+	if err = checkSchemaVersion(resp.Header.Get("Content-Type"), body, 1, schema1.MediaTypeManifest, schema1.MediaTypeSignedManifest); err != nil {
+		return nil, err
+	}
+
 	signedManifest := &schema1.SignedManifest{}
 	err = signedManifest.UnmarshalJSON(body)
 	if err != nil {
@@ -63,11 +148,17 @@ func (registry *Registry) Manifest(repository, reference string) (*schema1.Signe
 	return signedManifest, nil
 }
 
+// ManifestV2 fetches a schema2 manifest. It is a thin wrapper around
+// ManifestV2WithContext using context.Background().
 func (registry *Registry) ManifestV2(repository, reference string) (*schema2.DeserializedManifest, error) {
+	return registry.ManifestV2WithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestV2WithContext(ctx context.Context, repository, reference string) (*schema2.DeserializedManifest, error) {
 	url := registry.url("/v2/%s/manifests/%s", repository, reference)
 	registry.Logf("registry.manifest.get url=%s repository=%s reference=%s", url, repository, reference)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +175,10 @@ func (registry *Registry) ManifestV2(repository, reference string) (*schema2.Des
 		return nil, err
 	}
 
+	if err = checkSchemaVersion(resp.Header.Get("Content-Type"), body, 2, schema2.MediaTypeManifest); err != nil {
+		return nil, err
+	}
+
 	deserialized := &schema2.DeserializedManifest{}
 	err = deserialized.UnmarshalJSON(body)
 	if err != nil {
@@ -92,11 +187,168 @@ func (registry *Registry) ManifestV2(repository, reference string) (*schema2.Des
 	return deserialized, nil
 }
 
+// ManifestOCI fetches an OCI image manifest (application/vnd.oci.image.manifest.v1+json).
+// It is a thin wrapper around ManifestOCIWithContext using context.Background().
+func (registry *Registry) ManifestOCI(repository, reference string) (*ocischema.DeserializedManifest, error) {
+	return registry.ManifestOCIWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestOCIWithContext(ctx context.Context, repository, reference string) (*ocischema.DeserializedManifest, error) {
+	url := registry.url("/v2/%s/manifests/%s", repository, reference)
+	registry.Logf("registry.manifest.get url=%s repository=%s reference=%s", url, repository, reference)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", ocischema.MediaTypeManifest)
+	resp, err := registry.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	deserialized := &ocischema.DeserializedManifest{}
+	err = deserialized.UnmarshalJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return deserialized, nil
+}
+
+// ManifestIndex fetches an OCI image index (application/vnd.oci.image.index.v1+json).
+// It returns *manifestlist.DeserializedManifestList rather than an
+// ocischema index type: github.com/docker/distribution does not define a
+// separate Go type for the OCI index, since it's structurally identical to
+// a Docker manifest list and manifestlist.DeserializedManifestList already
+// round-trips both mediaType values. It is a thin wrapper around
+// ManifestIndexWithContext using context.Background().
+func (registry *Registry) ManifestIndex(repository, reference string) (*manifestlist.DeserializedManifestList, error) {
+	return registry.ManifestIndexWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestIndexWithContext(ctx context.Context, repository, reference string) (*manifestlist.DeserializedManifestList, error) {
+	url := registry.url("/v2/%s/manifests/%s", repository, reference)
+	registry.Logf("registry.manifest.get url=%s repository=%s reference=%s", url, repository, reference)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", manifestlist.MediaTypeImageIndex)
+	resp, err := registry.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	deserialized := &manifestlist.DeserializedManifestList{}
+	err = deserialized.UnmarshalJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return deserialized, nil
+}
+
+// GetManifest fetches whichever manifest type the registry holds for
+// repository/reference: schema1, schema2, OCI manifest, Docker manifest
+// list, or OCI image index. It sends a combined Accept header covering all
+// of them and dispatches on the response Content-Type. It is a thin
+// wrapper around GetManifestWithContext using context.Background().
+func (registry *Registry) GetManifest(repository, reference string) (distribution.Manifest, string, error) {
+	return registry.GetManifestWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) GetManifestWithContext(ctx context.Context, repository, reference string) (distribution.Manifest, string, error) {
+	url := registry.url("/v2/%s/manifests/%s", repository, reference)
+	registry.Logf("registry.manifest.get url=%s repository=%s reference=%s", url, repository, reference)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Set("Accept", acceptAllManifestTypes)
+	resp, err := registry.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	manifest, _, err := distribution.UnmarshalManifest(contentType, body)
+	if err != nil {
+		return nil, "", err
+	}
+	return manifest, contentType, nil
+}
+
+// ManifestForPlatform fetches the manifest list or OCI image index for
+// repository/reference, picks the entry matching platform by architecture,
+// OS, and (when set) variant, and fetches the concrete manifest that entry
+// points to by digest. It saves callers from having to walk the list
+// themselves for the common "give me the manifest for linux/amd64" case.
+func (registry *Registry) ManifestForPlatform(repository, reference string, platform PlatformSpec) (distribution.Manifest, digest.Digest, error) {
+	return registry.ManifestForPlatformWithContext(context.Background(), repository, reference, platform)
+}
+
+func (registry *Registry) ManifestForPlatformWithContext(ctx context.Context, repository, reference string, platform PlatformSpec) (distribution.Manifest, digest.Digest, error) {
+	list, _, err := registry.GetManifestWithContext(ctx, repository, reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifestList, ok := list.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return nil, "", errors.New("registry: reference does not resolve to a manifest list or image index")
+	}
+
+	for _, entry := range manifestList.Manifests {
+		if entry.Platform.Architecture != platform.Architecture || entry.Platform.OS != platform.OS {
+			continue
+		}
+		if platform.Variant != "" && entry.Platform.Variant != platform.Variant {
+			continue
+		}
+
+		manifest, _, err := registry.GetManifestWithContext(ctx, repository, entry.Digest.String())
+		if err != nil {
+			return nil, "", err
+		}
+		return manifest, entry.Digest, nil
+	}
+
+	return nil, "", fmt.Errorf("registry: no manifest for platform %s/%s in %s:%s", platform.OS, platform.Architecture, repository, reference)
+}
+
+// ManifestDigest is a thin wrapper around ManifestDigestWithContext using
+// context.Background().
 func (registry *Registry) ManifestDigest(repository, reference string) (digest.Digest, error) {
+	return registry.ManifestDigestWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestDigestWithContext(ctx context.Context, repository, reference string) (digest.Digest, error) {
 	url := registry.url("/v2/%s/manifests/%s", repository, reference)
 	registry.Logf("registry.manifest.head url=%s repository=%s reference=%s", url, repository, reference)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -111,11 +363,17 @@ func (registry *Registry) ManifestDigest(repository, reference string) (digest.D
 	return digest.Parse(resp.Header.Get("Docker-Content-Digest"))
 }
 
+// ManifestList is a thin wrapper around ManifestListWithContext using
+// context.Background().
 func (registry *Registry) ManifestList(repository, reference string) (bool, *ManifestList, error) {
+	return registry.ManifestListWithContext(context.Background(), repository, reference)
+}
+
+func (registry *Registry) ManifestListWithContext(ctx context.Context, repository, reference string) (bool, *ManifestList, error) {
 	url := registry.url("/v2/%s/manifests/%s", repository, reference)
 	registry.Logf("registry.manifest.head url=%s repository=%s reference=%s", url, repository, reference)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return false, nil, err
 	}
@@ -144,11 +402,17 @@ func (registry *Registry) ManifestList(repository, reference string) (bool, *Man
 	return isManifestList, &manifestList, nil
 }
 
+// DeleteManifest is a thin wrapper around DeleteManifestWithContext using
+// context.Background().
 func (registry *Registry) DeleteManifest(repository string, digest digest.Digest) error {
+	return registry.DeleteManifestWithContext(context.Background(), repository, digest)
+}
+
+func (registry *Registry) DeleteManifestWithContext(ctx context.Context, repository string, digest digest.Digest) error {
 	url := registry.url("/v2/%s/manifests/%s", repository, digest)
 	registry.Logf("registry.manifest.delete url=%s repository=%s reference=%s", url, repository, digest)
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return err
 	}
@@ -162,7 +426,13 @@ func (registry *Registry) DeleteManifest(repository string, digest digest.Digest
 	return nil
 }
 
+// PutManifest is a thin wrapper around PutManifestWithContext using
+// context.Background().
 func (registry *Registry) PutManifest(repository, reference string, manifest distribution.Manifest) error {
+	return registry.PutManifestWithContext(context.Background(), repository, reference, manifest)
+}
+
+func (registry *Registry) PutManifestWithContext(ctx context.Context, repository, reference string, manifest distribution.Manifest) error {
 	url := registry.url("/v2/%s/manifests/%s", repository, reference)
 	registry.Logf("registry.manifest.put url=%s repository=%s reference=%s", url, repository, reference)
 
@@ -172,7 +442,7 @@ func (registry *Registry) PutManifest(repository, reference string, manifest dis
 	}
 
 	buffer := bytes.NewBuffer(payload)
-	req, err := http.NewRequest("PUT", url, buffer)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, buffer)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+)
+
+func TestCheckSchemaVersionSchema1Signed(t *testing.T) {
+	body := []byte(`{"schemaVersion":1}`)
+	err := checkSchemaVersion(schema1.MediaTypeSignedManifest, body, 1, schema1.MediaTypeManifest, schema1.MediaTypeSignedManifest)
+	if err != nil {
+		t.Fatalf("expected signed schema1 response to be accepted, got %v", err)
+	}
+}
+
+func TestCheckSchemaVersionContentTypeWithCharset(t *testing.T) {
+	body := []byte(`{"schemaVersion":1}`)
+	err := checkSchemaVersion(schema1.MediaTypeSignedManifest+"; charset=utf-8", body, 1, schema1.MediaTypeManifest, schema1.MediaTypeSignedManifest)
+	if err != nil {
+		t.Fatalf("expected charset parameter to be ignored, got %v", err)
+	}
+}
+
+func TestCheckSchemaVersionNoContentType(t *testing.T) {
+	body := []byte(`{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `"}`)
+	err := checkSchemaVersion("", body, 2, schema2.MediaTypeManifest)
+	if err != nil {
+		t.Fatalf("expected missing Content-Type to fall back to body fields, got %v", err)
+	}
+}
+
+func TestCheckSchemaVersionMismatchedSchemaVersion(t *testing.T) {
+	body := []byte(`{"schemaVersion":1}`)
+	err := checkSchemaVersion(schema1.MediaTypeSignedManifest, body, 2, schema2.MediaTypeManifest)
+	if err != ErrUnexpectedSchemaVersion {
+		t.Fatalf("expected ErrUnexpectedSchemaVersion, got %v", err)
+	}
+}
+
+func TestCheckSchemaVersionMismatchedContentType(t *testing.T) {
+	body := []byte(`{"schemaVersion":1}`)
+	err := checkSchemaVersion(schema2.MediaTypeManifest, body, 1, schema1.MediaTypeManifest, schema1.MediaTypeSignedManifest)
+	if err != ErrUnexpectedSchemaVersion {
+		t.Fatalf("expected ErrUnexpectedSchemaVersion, got %v", err)
+	}
+}
+
+func TestCheckSchemaVersionMismatchedBodyMediaType(t *testing.T) {
+	body := []byte(`{"schemaVersion":2,"mediaType":"` + schema1.MediaTypeManifest + `"}`)
+	err := checkSchemaVersion(schema2.MediaTypeManifest, body, 2, schema2.MediaTypeManifest)
+	if err != ErrUnexpectedSchemaVersion {
+		t.Fatalf("expected ErrUnexpectedSchemaVersion, got %v", err)
+	}
+}
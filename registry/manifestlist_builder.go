@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ManifestListBuilder assembles a manifest list or OCI image index from the
+// per-platform manifests that make it up. Use NewManifestListBuilder, call
+// AddManifest once per platform, then Build to obtain a distribution.Manifest
+// suitable for PutManifestList.
+type ManifestListBuilder struct {
+	mediaType   string
+	descriptors []manifestlist.ManifestDescriptor
+}
+
+// NewManifestListBuilder starts a builder for a manifest list or image
+// index. mediaType should be manifestlist.MediaTypeManifestList for a Docker
+// manifest list or manifestlist.MediaTypeImageIndex for an OCI image index.
+func NewManifestListBuilder(mediaType string) *ManifestListBuilder {
+	return &ManifestListBuilder{mediaType: mediaType}
+}
+
+// AddManifest adds one platform-specific manifest to the list being built.
+func (b *ManifestListBuilder) AddManifest(platform PlatformSpec, dgst digest.Digest, size int64, mediaType string) {
+	b.descriptors = append(b.descriptors, manifestlist.ManifestDescriptor{
+		Descriptor: distribution.Descriptor{
+			MediaType: mediaType,
+			Digest:    dgst,
+			Size:      size,
+		},
+		Platform: manifestlist.PlatformSpec{
+			Architecture: platform.Architecture,
+			OS:           platform.OS,
+			Variant:      platform.Variant,
+			OSVersion:    platform.OSVersion,
+			OSFeatures:   platform.OSFeatures,
+			Features:     platform.Features,
+		},
+	})
+}
+
+// Build produces the assembled manifest list or OCI image index, ready to be
+// passed to PutManifestList.
+func (b *ManifestListBuilder) Build() (distribution.Manifest, error) {
+	deserialized, err := manifestlist.FromDescriptors(b.descriptors)
+	if err != nil {
+		return nil, err
+	}
+	if b.mediaType == manifestlist.MediaTypeManifestList || b.mediaType == "" {
+		return deserialized, nil
+	}
+
+	// FromDescriptors always stamps manifestlist.MediaTypeManifestList; for
+	// an OCI image index we re-marshal with the requested mediaType and
+	// round-trip it back through UnmarshalJSON so the in-memory manifest
+	// matches what Payload() will send over the wire.
+	_, payload, err := deserialized.Payload()
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	raw["mediaType"] = b.mediaType
+	payload, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ociIndex := &manifestlist.DeserializedManifestList{}
+	if err := ociIndex.UnmarshalJSON(payload); err != nil {
+		return nil, err
+	}
+	return ociIndex, nil
+}
+
+// PutManifestList pushes a manifest list or OCI image index built with
+// ManifestListBuilder, or fetched via ManifestIndex or GetManifest, to
+// repository under reference.
+func (registry *Registry) PutManifestList(repository, reference string, list distribution.Manifest) error {
+	return registry.PutManifestListWithContext(context.Background(), repository, reference, list)
+}
+
+func (registry *Registry) PutManifestListWithContext(ctx context.Context, repository, reference string, list distribution.Manifest) error {
+	url := registry.url("/v2/%s/manifests/%s", repository, reference)
+	registry.Logf("registry.manifest.put url=%s repository=%s reference=%s", url, repository, reference)
+
+	mediaType, payload, err := list.Payload()
+	if err != nil {
+		return err
+	}
+
+	buffer := bytes.NewBuffer(payload)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, buffer)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := registry.Client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
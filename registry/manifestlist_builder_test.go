@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const testDigest = digest.Digest("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b85")
+
+func TestManifestListBuilderBuildDockerList(t *testing.T) {
+	b := NewManifestListBuilder(manifestlist.MediaTypeManifestList)
+	b.AddManifest(PlatformSpec{Architecture: "amd64", OS: "linux"}, testDigest, 1234, schema2.MediaTypeManifest)
+
+	manifest, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		t.Fatalf("Payload: %v", err)
+	}
+	if mediaType != manifestlist.MediaTypeManifestList {
+		t.Fatalf("mediaType = %q, want %q", mediaType, manifestlist.MediaTypeManifestList)
+	}
+
+	var decoded struct {
+		MediaType string `json:"mediaType"`
+		Manifests []struct {
+			Digest   digest.Digest `json:"digest"`
+			Platform struct {
+				Architecture string `json:"architecture"`
+				OS           string `json:"os"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if len(decoded.Manifests) != 1 || decoded.Manifests[0].Digest != testDigest {
+		t.Fatalf("unexpected manifests in payload: %+v", decoded.Manifests)
+	}
+}
+
+func TestManifestListBuilderBuildOCIIndex(t *testing.T) {
+	b := NewManifestListBuilder(manifestlist.MediaTypeImageIndex)
+	b.AddManifest(PlatformSpec{Architecture: "arm64", OS: "linux", Variant: "v8"}, testDigest, 1234, schema2.MediaTypeManifest)
+
+	manifest, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		t.Fatalf("Payload: %v", err)
+	}
+	if mediaType != manifestlist.MediaTypeImageIndex {
+		t.Fatalf("mediaType = %q, want %q", mediaType, manifestlist.MediaTypeImageIndex)
+	}
+
+	var decoded struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if decoded.MediaType != manifestlist.MediaTypeImageIndex {
+		t.Fatalf("payload mediaType = %q, want %q", decoded.MediaType, manifestlist.MediaTypeImageIndex)
+	}
+}
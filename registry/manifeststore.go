@@ -0,0 +1,10 @@
+package registry
+
+import "github.com/Mirai233/docker-registry-client/registry/manifeststore"
+
+// ManifestStore returns a manifest store rooted at baseDir for staging
+// per-arch manifests across multiple invocations before assembling and
+// pushing a manifest list with ManifestListBuilder and PutManifestList.
+func (registry *Registry) ManifestStore(baseDir string) *manifeststore.Store {
+	return manifeststore.NewStore(baseDir)
+}
@@ -0,0 +1,127 @@
+// Package manifeststore persists manifests fetched (and annotated) while
+// assembling a multi-arch manifest list, so the assembly can span several
+// CLI invocations: fetch one per-arch manifest at a time, annotate it with
+// its platform, then build and push the list once every arch is present.
+package manifeststore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/distribution"
+)
+
+// PlatformOverride carries platform values that should take precedence over
+// whatever is recorded in the fetched image config, e.g. because the
+// registry doesn't natively support the platform and the caller knows
+// better (variant on ARM, or a Windows os.version).
+type PlatformOverride struct {
+	OS           string   `json:"os,omitempty"`
+	Architecture string   `json:"architecture,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	OSVersion    string   `json:"osVersion,omitempty"`
+	OSFeatures   []string `json:"osFeatures,omitempty"`
+}
+
+// ImageManifest is a single manifest staged for inclusion in a manifest
+// list: its raw bytes, media type, descriptor (for the entry written into
+// the list), and any platform annotation overriding what was read from the
+// image config.
+type ImageManifest struct {
+	Ref        string                  `json:"ref"`
+	MediaType  string                  `json:"mediaType"`
+	Manifest   []byte                  `json:"manifest"`
+	Descriptor distribution.Descriptor `json:"descriptor"`
+	Platform   *PlatformOverride       `json:"platform,omitempty"`
+}
+
+// Store persists ImageManifest records under BaseDir, keyed by
+// <transaction>/<sha256-of-ref>.json.
+type Store struct {
+	BaseDir string
+}
+
+// NewStore returns a Store rooted at baseDir. baseDir is created on first
+// Save if it does not already exist.
+func NewStore(baseDir string) *Store {
+	return &Store{BaseDir: baseDir}
+}
+
+func (s *Store) path(transaction, ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return filepath.Join(s.BaseDir, transaction, hex.EncodeToString(sum[:])+".json")
+}
+
+// Save annotates the manifest with any platform override and persists it
+// under transaction.
+func (s *Store) Save(transaction string, manifest ImageManifest, platform *PlatformOverride) error {
+	manifest.Platform = platform
+
+	path := s.path(transaction, manifest.Ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Get returns the manifest staged for ref under transaction.
+func (s *Store) Get(transaction, ref string) (ImageManifest, error) {
+	data, err := os.ReadFile(s.path(transaction, ref))
+	if err != nil {
+		return ImageManifest{}, err
+	}
+
+	var manifest ImageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ImageManifest{}, err
+	}
+	return manifest, nil
+}
+
+// GetList returns every manifest staged under transaction, in no
+// particular order, ready to be handed to a ManifestListBuilder.
+func (s *Store) GetList(transaction string) ([]ImageManifest, error) {
+	entries, err := os.ReadDir(filepath.Join(s.BaseDir, transaction))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]ImageManifest, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.BaseDir, transaction, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var manifest ImageManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// Remove discards the staged manifest for ref under transaction.
+func (s *Store) Remove(transaction, ref string) error {
+	err := os.Remove(s.path(transaction, ref))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package manifeststore
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	digest "github.com/opencontainers/go-digest"
+)
+
+func TestSaveGetRemove(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	manifest := ImageManifest{
+		Ref:       "example.com/repo:linux-amd64",
+		MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+		Manifest:  []byte(`{"schemaVersion":2}`),
+		Descriptor: distribution.Descriptor{
+			MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+			Digest:    digest.Digest("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b85"),
+			Size:      1234,
+		},
+	}
+	platform := &PlatformOverride{OS: "linux", Architecture: "amd64"}
+
+	if err := store.Save("txn1", manifest, platform); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Get("txn1", manifest.Ref)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Ref != manifest.Ref || got.Descriptor.Digest != manifest.Descriptor.Digest {
+		t.Fatalf("Get returned %+v, want %+v", got, manifest)
+	}
+	if got.Platform == nil || got.Platform.OS != "linux" || got.Platform.Architecture != "amd64" {
+		t.Fatalf("Get returned platform %+v, want %+v", got.Platform, platform)
+	}
+
+	if err := store.Remove("txn1", manifest.Ref); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := store.Get("txn1", manifest.Ref); err == nil {
+		t.Fatal("expected Get to fail after Remove")
+	}
+
+	// Remove is idempotent.
+	if err := store.Remove("txn1", manifest.Ref); err != nil {
+		t.Fatalf("Remove on already-removed entry: %v", err)
+	}
+}
+
+func TestGetList(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	refs := []string{
+		"example.com/repo:linux-amd64",
+		"example.com/repo:linux-arm64",
+	}
+	for _, ref := range refs {
+		manifest := ImageManifest{Ref: ref, MediaType: "application/vnd.docker.distribution.manifest.v2+json"}
+		if err := store.Save("txn1", manifest, nil); err != nil {
+			t.Fatalf("Save(%s): %v", ref, err)
+		}
+	}
+
+	list, err := store.GetList("txn1")
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+	if len(list) != len(refs) {
+		t.Fatalf("GetList returned %d manifests, want %d", len(list), len(refs))
+	}
+
+	seen := map[string]bool{}
+	for _, manifest := range list {
+		seen[manifest.Ref] = true
+	}
+	for _, ref := range refs {
+		if !seen[ref] {
+			t.Fatalf("GetList missing ref %s", ref)
+		}
+	}
+}
+
+func TestGetListEmptyTransaction(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	list, err := store.GetList("no-such-transaction")
+	if err != nil {
+		t.Fatalf("GetList on nonexistent transaction: %v", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected no manifests, got %d", len(list))
+	}
+}